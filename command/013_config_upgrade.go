@@ -1,14 +1,17 @@
 package command
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/configs"
@@ -27,9 +30,16 @@ func (c *ZeroThirteenUpgradeCommand) Run(args []string) int {
 	args = c.Meta.process(args)
 	flags := c.Meta.defaultFlagSet("0.13upgrade")
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	var jsonOutput, dryRun bool
+	flags.BoolVar(&jsonOutput, "json", false, "produce a machine-readable JSON description of the upgrade instead of human-readable output")
+	flags.BoolVar(&dryRun, "dry-run", false, "describe the upgrade that would be performed, without writing any files")
 	if err := flags.Parse(args); err != nil {
 		return 1
 	}
+	// -json only describes the upgrade; it never writes files.
+	if jsonOutput {
+		dryRun = true
+	}
 
 	var diags tfdiags.Diagnostics
 
@@ -106,23 +116,57 @@ func (c *ZeroThirteenUpgradeCommand) Run(args []string) int {
 		return 1
 	}
 
-	// FIXME: It's not clear what the correct behaviour is for upgrading
-	// override files. For now, just log that we're ignoring the file.
+	// Load and parse all override files. These are handled separately from
+	// the primary files below, once we know which required_providers
+	// entries they override.
+	overrideFiles := make(map[string]*configs.File)
 	for _, path := range overrides {
-		c.Ui.Warn(fmt.Sprintf("Ignoring override file %q: not implemented", path))
+		file, fileDiags := parser.LoadConfigFile(path)
+		diags = diags.Append(fileDiags)
+		if file != nil {
+			overrideFiles[path] = file
+		}
+	}
+	if diags.HasErrors() {
+		c.Ui.Error(strings.TrimSpace("Failed to load configuration"))
+		c.showDiagnostics(diags)
+		return 1
 	}
 
-	// Build up a list of required providers, uniquely by local name
+	// Build up a list of required providers, uniquely by local name, along
+	// with a record of which file originally declared each one. An origin
+	// of "" means the entry was only discovered implicitly (from a
+	// provider or resource block, or an override with no corresponding
+	// base declaration), and so has no existing required_providers block
+	// to be rewritten in place.
 	requiredProviders := make(map[string]*configs.RequiredProvider)
+	originFiles := make(map[string]string)
+	detectedFrom := make(map[string]string)
 	var rewritePaths []string
+	rewritePathSeen := make(map[string]bool)
 
-	// Step 1: copy all explicit provider requirements across
-	for path, file := range files {
+	// Step 1: copy all explicit provider requirements across. We iterate
+	// over primary (rather than ranging over the files map directly) so
+	// that, when the same provider local name is declared in more than
+	// one file, which file "wins" as its origin is deterministic rather
+	// than depending on Go's randomized map iteration order.
+	for _, path := range primary {
+		file, ok := files[path]
+		if !ok {
+			continue
+		}
 		log.Printf("[DEBUG] processing required_providers from %s", path)
 
 		for _, rps := range file.RequiredProviders {
 			log.Printf("[DEBUG] found required_providers block")
-			rewritePaths = append(rewritePaths, path)
+			// A single file may contain more than one required_providers
+			// block (across multiple terraform blocks); rewriteRequiredProviders
+			// handles all of them in one pass, so it should only be called
+			// once per file.
+			if !rewritePathSeen[path] {
+				rewritePathSeen[path] = true
+				rewritePaths = append(rewritePaths, path)
+			}
 			for _, rp := range rps.RequiredProviders {
 				log.Printf("[DEBUG] required_provider %q", rp.Name)
 				if previous, exist := requiredProviders[rp.Name]; exist {
@@ -145,13 +189,72 @@ func (c *ZeroThirteenUpgradeCommand) Run(args []string) int {
 						Requirement: rp.Requirement,
 						DeclRange:   rp.DeclRange,
 					}
+					originFiles[rp.Name] = path
+					detectedFrom[rp.Name] = "explicit"
 					log.Printf("[DEBUG] configuration %#v", rp)
 				}
 			}
 		}
 	}
 
-	for path, file := range files {
+	// Step 1b: merge in required_providers entries declared in override
+	// files. Per override semantics, an override only takes precedence for
+	// the attributes it actually sets; any attribute it leaves unset keeps
+	// the base configuration's value, rather than the whole entry being
+	// replaced wholesale. The entry still belongs to whichever base file
+	// originally declared it (if any) for the purposes of rewriting; the
+	// override file itself is left with the requirement stripped out,
+	// since it's now redundant.
+	overrideLocalNames := make(map[string][]string)
+	for _, path := range overrides {
+		file, ok := overrideFiles[path]
+		if !ok {
+			continue
+		}
+		log.Printf("[DEBUG] processing required_providers overrides from %s", path)
+
+		for _, rps := range file.RequiredProviders {
+			for _, rp := range rps.RequiredProviders {
+				log.Printf("[DEBUG] override required_provider %q", rp.Name)
+
+				merged := &configs.RequiredProvider{
+					Name:        rp.Name,
+					Source:      rp.Source,
+					Type:        rp.Type,
+					Requirement: rp.Requirement,
+					DeclRange:   rp.DeclRange,
+				}
+				if base, exist := requiredProviders[rp.Name]; exist {
+					merged = &configs.RequiredProvider{
+						Name:        rp.Name,
+						Source:      base.Source,
+						Type:        base.Type,
+						Requirement: base.Requirement,
+						DeclRange:   rp.DeclRange,
+					}
+					if rp.Source != "" {
+						merged.Source = rp.Source
+						merged.Type = rp.Type
+					}
+					if rp.Requirement.Required.String() != "" {
+						merged.Requirement = rp.Requirement
+					}
+				} else {
+					originFiles[rp.Name] = ""
+				}
+
+				requiredProviders[rp.Name] = merged
+				detectedFrom[rp.Name] = "override"
+				overrideLocalNames[path] = append(overrideLocalNames[path], rp.Name)
+			}
+		}
+	}
+
+	for _, path := range primary {
+		file, ok := files[path]
+		if !ok {
+			continue
+		}
 		log.Printf("[DEBUG] processing %s", path)
 		// Step 2: add missing provider requirements from provider blocks
 		for _, p := range file.ProviderConfigs {
@@ -166,6 +269,8 @@ func (c *ZeroThirteenUpgradeCommand) Run(args []string) int {
 					Type:        addrs.NewLegacyProvider(p.Name),
 					Requirement: p.Version,
 				}
+				originFiles[p.Name] = ""
+				detectedFrom[p.Name] = "provider_block"
 			}
 		}
 
@@ -196,6 +301,8 @@ func (c *ZeroThirteenUpgradeCommand) Run(args []string) int {
 						Name: localName,
 						Type: addrs.NewLegacyProvider(localName),
 					}
+					originFiles[localName] = ""
+					detectedFrom[localName] = "resource"
 				}
 			}
 		}
@@ -204,6 +311,7 @@ func (c *ZeroThirteenUpgradeCommand) Run(args []string) int {
 	// We should now have a complete understanding of the provider requirements
 	// stated in the config.  If there are any providers, attempt to detect
 	// their sources, and rewrite the config.
+	var rewrites []fileRewrite
 	if len(requiredProviders) > 0 {
 		detectDiags := c.detectProviderSources(requiredProviders)
 		diags = diags.Append(detectDiags)
@@ -213,114 +321,76 @@ func (c *ZeroThirteenUpgradeCommand) Run(args []string) int {
 			return 1
 		}
 
-		// FIXME
-		if len(rewritePaths) != 1 {
-			c.Ui.Error("Not implemented")
-			c.showDiagnostics(diags)
-			return 1
-		}
-
-		// Load and parse the output configuration file
-		filename := rewritePaths[0]
-		config, err := ioutil.ReadFile(filename)
-		if err != nil {
-			diags = diags.Append(tfdiags.Sourceless(
-				tfdiags.Error,
-				"Unable to read configuration file",
-				fmt.Sprintf("Error when reading configuration file %q: %s", filename, err),
-			))
-			c.showDiagnostics(diags)
-			return 1
-		}
-		out, parseDiags := hclwrite.ParseConfig(config, filename, hcl.InitialPos)
-		diags = diags.Append(parseDiags)
-		if diags.HasErrors() {
-			c.showDiagnostics(diags)
-			return 1
-		}
-
-		// Find all required_providers blocks, and store them alongside a map
-		// back to the parent terraform block.
-		var requiredProviderBlocks []*hclwrite.Block
-		parentBlocks := make(map[*hclwrite.Block]*hclwrite.Block)
-		root := out.Body()
-		for _, rootBlock := range root.Blocks() {
-			if rootBlock.Type() != "terraform" {
+		// Partition the required providers by the file that originally
+		// declared them, so that each rewritePath is only ever touched for
+		// its own subset. Entries with no origin file (discovered only
+		// from a provider/resource block, or from an override with no
+		// corresponding base declaration) are left over as residual, to be
+		// written into a new file.
+		byFile := make(map[string][]string)
+		var residual []string
+		for localName, path := range originFiles {
+			if path == "" {
+				residual = append(residual, localName)
 				continue
 			}
-			for _, childBlock := range rootBlock.Body().Blocks() {
-				if childBlock.Type() == "required_providers" {
-					requiredProviderBlocks = append(requiredProviderBlocks, childBlock)
-					parentBlocks[childBlock] = rootBlock
-				}
-			}
-		}
-
-		first, rest := requiredProviderBlocks[0], requiredProviderBlocks[1:]
-
-		// Find the body of the first block to prepare for rewriting it
-		body := first.Body()
-
-		// Build a sorted list of provider local names
-		var localNames []string
-		for localName := range requiredProviders {
-			localNames = append(localNames, localName)
+			byFile[path] = append(byFile[path], localName)
 		}
-		sort.Strings(localNames)
 
-		// Populate the required providers block
-		for _, localName := range localNames {
-			requiredProvider := requiredProviders[localName]
-			var attributes = make(map[string]cty.Value)
-
-			if !requiredProvider.Type.IsZero() {
-				attributes["source"] = cty.StringVal(requiredProvider.Type.String())
+		for _, path := range rewritePaths {
+			localNames := byFile[path]
+			sort.Strings(localNames)
+			rewrite, rewriteDiags := c.rewriteRequiredProviders(path, localNames, requiredProviders, dryRun)
+			diags = diags.Append(rewriteDiags)
+			if diags.HasErrors() {
+				c.showDiagnostics(diags)
+				return 1
 			}
+			rewrites = append(rewrites, rewrite)
+		}
 
-			if version := requiredProvider.Requirement.Required.String(); version != "" {
-				attributes["version"] = cty.StringVal(version)
+		if len(residual) > 0 {
+			sort.Strings(residual)
+			rewrite, newFileDiags := c.writeNewRequiredProviders(dir, residual, requiredProviders, dryRun)
+			diags = diags.Append(newFileDiags)
+			if diags.HasErrors() {
+				c.showDiagnostics(diags)
+				return 1
 			}
-
-			body.SetAttributeValue(localName, cty.MapVal(attributes))
-
-			// FIXME: how do we add the comment if there's no source?
+			rewrites = append(rewrites, rewrite)
 		}
 
-		// Remove the rest of the blocks (and the parent block, if it's empty)
-		for _, rpBlock := range rest {
-			tfBlock := parentBlocks[rpBlock]
-			tfBody := tfBlock.Body()
-			tfBody.RemoveBlock(rpBlock)
-
-			// If the terraform block has no blocks and no attributes, it's
-			// basically empty (aside from comments and whitespace), so it's
-			// more useful to remove it than leave it in.
-			if len(tfBody.Blocks()) == 0 && len(tfBody.Attributes()) == 0 {
-				root.RemoveBlock(tfBlock)
+		// Finally, strip the now-redundant required_providers entries back
+		// out of the override files that declared them; their values have
+		// already been merged into the base configuration above. We iterate
+		// over overrides (rather than ranging over overrideLocalNames
+		// directly) for the same reason as the primary file loops above:
+		// deterministic ordering of the rewrites, regardless of Go's
+		// randomized map iteration order.
+		for _, path := range overrides {
+			localNames, ok := overrideLocalNames[path]
+			if !ok {
+				continue
+			}
+			rewrite, overrideDiags := c.stripOverrideRequiredProviders(path, localNames, dryRun)
+			diags = diags.Append(overrideDiags)
+			if diags.HasErrors() {
+				c.showDiagnostics(diags)
+				return 1
 			}
+			rewrites = append(rewrites, rewrite)
 		}
+	}
 
-		// Write the config back to the file
-		f, err := os.OpenFile(filename, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, os.ModePerm)
-		if err != nil {
-			diags = diags.Append(tfdiags.Sourceless(
-				tfdiags.Error,
-				"Unable to open configuration file for writing",
-				fmt.Sprintf("Error when reading configuration file %q: %s", filename, err),
-			))
-			c.showDiagnostics(diags)
-			return 1
-		}
-		_, err = out.WriteTo(f)
+	if jsonOutput {
+		data, err := c.upgradeJSON(requiredProviders, detectedFrom, rewrites)
 		if err != nil {
-			diags = diags.Append(tfdiags.Sourceless(
-				tfdiags.Error,
-				"Unable to rewrite configuration file",
-				fmt.Sprintf("Error when rewriting configuration file %q: %s", filename, err),
-			))
+			diags = diags.Append(fmt.Errorf("Error producing JSON output: %s", err))
 			c.showDiagnostics(diags)
 			return 1
 		}
+		c.Ui.Output(string(data))
+		return 0
 	}
 
 	c.showDiagnostics(diags)
@@ -331,6 +401,15 @@ func (c *ZeroThirteenUpgradeCommand) Run(args []string) int {
 	if len(diags) != 0 {
 		c.Ui.Output(`-----------------------------------------------------------------------------`)
 	}
+	if dryRun {
+		c.Ui.Output(c.Colorize().Color(`
+[bold][green]Upgrade plan complete![reset]
+
+This was a dry run: no files were changed. Re-run without -dry-run to apply
+the upgrade.
+`))
+		return 0
+	}
 	c.Ui.Output(c.Colorize().Color(`
 [bold][green]Upgrade complete![reset]
 
@@ -388,6 +467,328 @@ func (c *ZeroThirteenUpgradeCommand) detectProviderSources(requiredProviders map
 	return diags
 }
 
+// fileRewrite describes the effect of rewriting a single configuration
+// file: its content before and after the upgrade. Original is empty for a
+// newly-created file.
+type fileRewrite struct {
+	Filename  string
+	Original  string
+	Rewritten string
+}
+
+// rewriteRequiredProviders rewrites the required_providers block(s) in the
+// given file in place, populating them with localNames. If the file
+// contains more than one required_providers block (which can happen if the
+// original author split them across multiple terraform blocks), only the
+// first one found is kept; the others are removed along with their parent
+// terraform block, if that block would otherwise be left empty.
+func (c *ZeroThirteenUpgradeCommand) rewriteRequiredProviders(filename string, localNames []string, requiredProviders map[string]*configs.RequiredProvider, dryRun bool) (fileRewrite, tfdiags.Diagnostics) {
+	original, out, diags := c.loadHCLFile(filename)
+	if diags.HasErrors() {
+		return fileRewrite{}, diags
+	}
+
+	root := out.Body()
+	requiredProviderBlocks, parentBlocks := findRequiredProvidersBlocks(root)
+	if len(requiredProviderBlocks) == 0 {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Missing required_providers block",
+			fmt.Sprintf("Expected to find a required_providers block in %q, but none was present.", filename),
+		))
+		return fileRewrite{}, diags
+	}
+
+	first, rest := requiredProviderBlocks[0], requiredProviderBlocks[1:]
+	populateRequiredProvidersBody(first.Body(), localNames, requiredProviders)
+	removeRequiredProvidersBlocks(root, rest, parentBlocks)
+
+	rewritten, writeDiags := c.writeHCLFile(filename, out, dryRun)
+	diags = diags.Append(writeDiags)
+	return fileRewrite{Filename: filename, Original: string(original), Rewritten: rewritten}, diags
+}
+
+// writeNewRequiredProviders creates a new "versions.tf" file in dir (or
+// "providers.tf", if "versions.tf" is already taken) containing a
+// required_providers block for localNames, which were discovered from
+// provider/resource blocks rather than from an existing required_providers
+// declaration.
+func (c *ZeroThirteenUpgradeCommand) writeNewRequiredProviders(dir string, localNames []string, requiredProviders map[string]*configs.RequiredProvider, dryRun bool) (fileRewrite, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+
+	filename := filepath.Join(dir, "versions.tf")
+	if _, err := os.Stat(filename); err == nil {
+		filename = filepath.Join(dir, "providers.tf")
+		if _, err := os.Stat(filename); err == nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Unable to create provider requirements file",
+				fmt.Sprintf("Both %q and %q already exist, so there is nowhere to write the detected provider requirements for %s.", filepath.Join(dir, "versions.tf"), filename, strings.Join(localNames, ", ")),
+			))
+			return fileRewrite{}, diags
+		}
+	}
+
+	out := hclwrite.NewEmptyFile()
+	tfBlock := out.Body().AppendNewBlock("terraform", nil)
+	rpBlock := tfBlock.Body().AppendNewBlock("required_providers", nil)
+	populateRequiredProvidersBody(rpBlock.Body(), localNames, requiredProviders)
+
+	rewritten, writeDiags := c.writeHCLFile(filename, out, dryRun)
+	diags = diags.Append(writeDiags)
+	return fileRewrite{Filename: filename, Rewritten: rewritten}, diags
+}
+
+// stripOverrideRequiredProviders removes the given local names from the
+// required_providers block(s) of an override file, since their values have
+// already been merged into the relevant base file (or a new file). Any
+// required_providers block (and parent terraform block) left empty by this
+// is removed entirely.
+func (c *ZeroThirteenUpgradeCommand) stripOverrideRequiredProviders(filename string, localNames []string, dryRun bool) (fileRewrite, tfdiags.Diagnostics) {
+	original, out, diags := c.loadHCLFile(filename)
+	if diags.HasErrors() {
+		return fileRewrite{}, diags
+	}
+
+	root := out.Body()
+	requiredProviderBlocks, parentBlocks := findRequiredProvidersBlocks(root)
+	var emptyBlocks []*hclwrite.Block
+	for _, rpBlock := range requiredProviderBlocks {
+		body := rpBlock.Body()
+		for _, localName := range localNames {
+			body.RemoveAttribute(localName)
+		}
+		if len(body.Attributes()) == 0 {
+			emptyBlocks = append(emptyBlocks, rpBlock)
+		}
+	}
+	removeRequiredProvidersBlocks(root, emptyBlocks, parentBlocks)
+
+	rewritten, writeDiags := c.writeHCLFile(filename, out, dryRun)
+	diags = diags.Append(writeDiags)
+	return fileRewrite{Filename: filename, Original: string(original), Rewritten: rewritten}, diags
+}
+
+// findRequiredProvidersBlocks finds all required_providers blocks nested
+// directly under a terraform block at the top level of root, along with a
+// map back to each one's parent terraform block.
+func findRequiredProvidersBlocks(root *hclwrite.Body) ([]*hclwrite.Block, map[*hclwrite.Block]*hclwrite.Block) {
+	var requiredProviderBlocks []*hclwrite.Block
+	parentBlocks := make(map[*hclwrite.Block]*hclwrite.Block)
+	for _, rootBlock := range root.Blocks() {
+		if rootBlock.Type() != "terraform" {
+			continue
+		}
+		for _, childBlock := range rootBlock.Body().Blocks() {
+			if childBlock.Type() == "required_providers" {
+				requiredProviderBlocks = append(requiredProviderBlocks, childBlock)
+				parentBlocks[childBlock] = rootBlock
+			}
+		}
+	}
+	return requiredProviderBlocks, parentBlocks
+}
+
+// removeRequiredProvidersBlocks removes each of the given required_providers
+// blocks, and also removes its parent terraform block if that leaves it
+// with no blocks or attributes of its own.
+func removeRequiredProvidersBlocks(root *hclwrite.Body, blocks []*hclwrite.Block, parentBlocks map[*hclwrite.Block]*hclwrite.Block) {
+	for _, rpBlock := range blocks {
+		tfBlock := parentBlocks[rpBlock]
+		tfBody := tfBlock.Body()
+		tfBody.RemoveBlock(rpBlock)
+
+		// If the terraform block has no blocks and no attributes, it's
+		// basically empty (aside from comments and whitespace), so it's
+		// more useful to remove it than leave it in.
+		if len(tfBody.Blocks()) == 0 && len(tfBody.Attributes()) == 0 {
+			root.RemoveBlock(tfBlock)
+		}
+	}
+}
+
+// populateRequiredProvidersBody sets an attribute in body for each of
+// localNames, describing the corresponding entry in requiredProviders. The
+// localNames are expected to already be sorted; that sort order is
+// preserved in the body regardless of whether a given entry ends up
+// preceded by a TF-UPGRADE-TODO comment.
+func populateRequiredProvidersBody(body *hclwrite.Body, localNames []string, requiredProviders map[string]*configs.RequiredProvider) {
+	for _, localName := range localNames {
+		requiredProvider := requiredProviders[localName]
+		var attributes = make(map[string]cty.Value)
+
+		if !requiredProvider.Type.IsZero() {
+			attributes["source"] = cty.StringVal(requiredProvider.Type.String())
+		}
+
+		if version := requiredProvider.Requirement.Required.String(); version != "" {
+			attributes["version"] = cty.StringVal(version)
+		}
+
+		// ObjectVal rather than MapVal, since an entry with neither a
+		// source nor a version has no attributes at all.
+		value := cty.ObjectVal(attributes)
+
+		// body may already have an attribute for localName, if it was
+		// explicitly declared in the file we're rewriting. Remove it first
+		// so that every entry is appended afresh in localNames order, and
+		// so that the replacement doesn't leave a duplicate attribute.
+		body.RemoveAttribute(localName)
+
+		if requiredProvider.Type.IsZero() {
+			// SetAttributeValue would strip any leading comment we attach
+			// to this attribute, so we have to fall back to constructing
+			// the attribute's tokens by hand and interleave them with the
+			// comment tokens ourselves.
+			appendAttributeWithComment(body, localName, value, noSourceDetectedComment(localName))
+			continue
+		}
+
+		body.SetAttributeValue(localName, value)
+	}
+}
+
+// appendAttributeWithComment appends "name = value" to the end of body,
+// preceded by the given comment text (which may span multiple lines, each
+// already beginning with "#").
+func appendAttributeWithComment(body *hclwrite.Body, name string, value cty.Value, comment string) {
+	var tokens hclwrite.Tokens
+
+	for _, line := range strings.Split(strings.TrimSuffix(comment, "\n"), "\n") {
+		tokens = append(tokens, &hclwrite.Token{
+			Type:  hclsyntax.TokenComment,
+			Bytes: []byte(line + "\n"),
+		})
+	}
+
+	tokens = append(tokens, &hclwrite.Token{
+		Type:  hclsyntax.TokenIdent,
+		Bytes: []byte(name),
+	})
+	tokens = append(tokens, &hclwrite.Token{
+		Type:  hclsyntax.TokenEqual,
+		Bytes: []byte(" = "),
+	})
+	tokens = append(tokens, hclwrite.TokensForValue(value)...)
+	tokens = append(tokens, &hclwrite.Token{
+		Type:  hclsyntax.TokenNewline,
+		Bytes: []byte("\n"),
+	})
+
+	body.AppendUnstructuredTokens(tokens)
+}
+
+// loadHCLFile reads and parses filename for in-place rewriting, returning
+// the file's original content alongside the parsed representation.
+func (c *ZeroThirteenUpgradeCommand) loadHCLFile(filename string) ([]byte, *hclwrite.File, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+
+	config, err := ioutil.ReadFile(filename)
+	if err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Unable to read configuration file",
+			fmt.Sprintf("Error when reading configuration file %q: %s", filename, err),
+		))
+		return nil, nil, diags
+	}
+	out, parseDiags := hclwrite.ParseConfig(config, filename, hcl.InitialPos)
+	diags = diags.Append(parseDiags)
+	return config, out, diags
+}
+
+// writeHCLFile returns the rewritten content of out, writing it to
+// filename (truncating any existing content) unless dryRun is set.
+func (c *ZeroThirteenUpgradeCommand) writeHCLFile(filename string, out *hclwrite.File, dryRun bool) (string, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+
+	rewritten := out.Bytes()
+	if dryRun {
+		return string(rewritten), diags
+	}
+
+	f, err := os.OpenFile(filename, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Unable to open configuration file for writing",
+			fmt.Sprintf("Error when opening configuration file %q: %s", filename, err),
+		))
+		return string(rewritten), diags
+	}
+	defer f.Close()
+
+	if _, err := f.Write(rewritten); err != nil {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Unable to rewrite configuration file",
+			fmt.Sprintf("Error when rewriting configuration file %q: %s", filename, err),
+		))
+	}
+	return string(rewritten), diags
+}
+
+// jsonProvider describes a single resolved required_providers entry for
+// -json output.
+type jsonProvider struct {
+	Source       string `json:"source,omitempty"`
+	Version      string `json:"version,omitempty"`
+	DetectedFrom string `json:"detected_from"`
+}
+
+// jsonFile describes a single file touched by the upgrade for -json
+// output. Original is omitted for a newly-created file.
+type jsonFile struct {
+	Filename  string `json:"filename"`
+	Original  string `json:"original,omitempty"`
+	Rewritten string `json:"rewritten"`
+}
+
+// jsonUpgrade is the top-level document produced for -json output.
+type jsonUpgrade struct {
+	Files               []jsonFile              `json:"files"`
+	Providers           map[string]jsonProvider `json:"providers"`
+	UndetectedProviders []string                `json:"undetected_providers,omitempty"`
+}
+
+// upgradeJSON assembles the -json output document describing the planned
+// upgrade. Run never writes files when -json is set.
+func (c *ZeroThirteenUpgradeCommand) upgradeJSON(requiredProviders map[string]*configs.RequiredProvider, detectedFrom map[string]string, rewrites []fileRewrite) ([]byte, error) {
+	result := jsonUpgrade{
+		Providers: make(map[string]jsonProvider, len(requiredProviders)),
+	}
+
+	var localNames []string
+	for localName := range requiredProviders {
+		localNames = append(localNames, localName)
+	}
+	sort.Strings(localNames)
+
+	for _, localName := range localNames {
+		rp := requiredProviders[localName]
+		entry := jsonProvider{
+			Version:      rp.Requirement.Required.String(),
+			DetectedFrom: detectedFrom[localName],
+		}
+		if !rp.Type.IsZero() {
+			entry.Source = rp.Type.String()
+		} else {
+			result.UndetectedProviders = append(result.UndetectedProviders, localName)
+		}
+		result.Providers[localName] = entry
+	}
+
+	for _, rewrite := range rewrites {
+		result.Files = append(result.Files, jsonFile{
+			Filename:  rewrite.Filename,
+			Original:  rewrite.Original,
+			Rewritten: rewrite.Rewritten,
+		})
+	}
+
+	return json.MarshalIndent(result, "", "  ")
+}
+
 func noSourceDetectedComment(name string) string {
 	return fmt.Sprintf(`# TF-UPGRADE-TODO
 #
@@ -404,10 +805,20 @@ func noSourceDetectedComment(name string) string {
 
 func (c *ZeroThirteenUpgradeCommand) Help() string {
 	helpText := `
-Usage: terraform 0.13upgrade [module-dir]
+Usage: terraform 0.13upgrade [options] [module-dir]
 
   Generates a "providers.tf" configuration file which includes source
   configuration for every non-default provider.
+
+Options:
+
+  -json      Produce a machine-readable JSON description of the upgrade,
+             including per-file diffs and the resolved provider
+             requirements, instead of writing files and printing
+             human-readable output.
+
+  -dry-run   Describe the upgrade that would be performed, without writing
+             any files. Can be combined with -json.
 `
 	return strings.TrimSpace(helpText)
 }
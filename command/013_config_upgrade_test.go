@@ -0,0 +1,242 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+)
+
+// TestZeroThirteenUpgradeCommand_rewriteRequiredProviders_noSourceDetected
+// exercises the fixture in testdata/013upgrade-no-source, which declares an
+// explicit required_providers entry for a provider local name ("mystery")
+// that has no source in the legacy registry lookup. Previously,
+// populateRequiredProvidersBody appended the TF-UPGRADE-TODO-commented
+// attribute without removing the pre-existing one, leaving the rewritten
+// file with the same attribute declared twice.
+func TestZeroThirteenUpgradeCommand_rewriteRequiredProviders_noSourceDetected(t *testing.T) {
+	fixture, err := ioutil.ReadFile("testdata/013upgrade-no-source/input.tf")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "013upgrade-no-source")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "main.tf")
+	if err := ioutil.WriteFile(filename, fixture, 0644); err != nil {
+		t.Fatalf("failed to write fixture to temp dir: %s", err)
+	}
+
+	// Simulate what detectProviderSources does when a provider's source
+	// can't be found: it leaves the provider's Type as the zero value.
+	requiredProviders := map[string]*configs.RequiredProvider{
+		"mystery": {
+			Name: "mystery",
+			Type: addrs.Provider{},
+		},
+	}
+
+	var c ZeroThirteenUpgradeCommand
+	_, diags := c.rewriteRequiredProviders(filename, []string{"mystery"}, requiredProviders, false)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %s", diags.Err())
+	}
+
+	rewritten, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read rewritten file: %s", err)
+	}
+
+	got := string(rewritten)
+	if count := strings.Count(got, "mystery ="); count != 1 {
+		t.Fatalf("expected exactly one \"mystery\" attribute in rewritten file, found %d:\n%s", count, got)
+	}
+	if !strings.Contains(got, "TF-UPGRADE-TODO") {
+		t.Fatalf("expected a TF-UPGRADE-TODO comment in rewritten file:\n%s", got)
+	}
+}
+
+// TestZeroThirteenUpgradeCommand_multiFileRewrite exercises the fixture in
+// testdata/013upgrade-multi-file, which spreads required_providers
+// declarations across two base files and one override file. It covers the
+// three paths Run partitions its work across: rewriting each base file with
+// only its own subset of providers, stripping a now-redundant override
+// file, and writing a brand new file for a provider with no origin file of
+// its own.
+func TestZeroThirteenUpgradeCommand_multiFileRewrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "013upgrade-multi-file")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"main.tf", "extra.tf", "override.tf"} {
+		fixture, err := ioutil.ReadFile(filepath.Join("testdata/013upgrade-multi-file", name))
+		if err != nil {
+			t.Fatalf("failed to read fixture %s: %s", name, err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), fixture, 0644); err != nil {
+			t.Fatalf("failed to write fixture %s to temp dir: %s", name, err)
+		}
+	}
+
+	requiredProviders := map[string]*configs.RequiredProvider{
+		"foo": {Name: "foo", Type: addrs.NewLegacyProvider("foo")},
+		"bar": {Name: "bar", Type: addrs.NewLegacyProvider("bar")},
+		"baz": {Name: "baz", Type: addrs.NewLegacyProvider("baz")},
+	}
+
+	var c ZeroThirteenUpgradeCommand
+
+	mainPath := filepath.Join(dir, "main.tf")
+	if _, diags := c.rewriteRequiredProviders(mainPath, []string{"foo"}, requiredProviders, false); diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics rewriting main.tf: %s", diags.Err())
+	}
+	mainGot, err := ioutil.ReadFile(mainPath)
+	if err != nil {
+		t.Fatalf("failed to read rewritten main.tf: %s", err)
+	}
+	if !strings.Contains(string(mainGot), "foo") || strings.Contains(string(mainGot), "bar") {
+		t.Fatalf("expected main.tf to contain only foo, got:\n%s", mainGot)
+	}
+
+	extraPath := filepath.Join(dir, "extra.tf")
+	if _, diags := c.rewriteRequiredProviders(extraPath, []string{"bar"}, requiredProviders, false); diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics rewriting extra.tf: %s", diags.Err())
+	}
+	extraGot, err := ioutil.ReadFile(extraPath)
+	if err != nil {
+		t.Fatalf("failed to read rewritten extra.tf: %s", err)
+	}
+	if !strings.Contains(string(extraGot), "bar") || strings.Contains(string(extraGot), "foo") {
+		t.Fatalf("expected extra.tf to contain only bar, got:\n%s", extraGot)
+	}
+
+	overridePath := filepath.Join(dir, "override.tf")
+	if _, diags := c.stripOverrideRequiredProviders(overridePath, []string{"foo"}, false); diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics stripping override.tf: %s", diags.Err())
+	}
+	overrideGot, err := ioutil.ReadFile(overridePath)
+	if err != nil {
+		t.Fatalf("failed to read stripped override.tf: %s", err)
+	}
+	if strings.Contains(string(overrideGot), "foo") {
+		t.Fatalf("expected override.tf to have its required_providers entry stripped, got:\n%s", overrideGot)
+	}
+
+	newFileRewrite, diags := c.writeNewRequiredProviders(dir, []string{"baz"}, requiredProviders, false)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics writing new required providers file: %s", diags.Err())
+	}
+	if newFileRewrite.Original != "" {
+		t.Fatalf("expected a newly-created file to have no original content, got:\n%s", newFileRewrite.Original)
+	}
+	versionsGot, err := ioutil.ReadFile(filepath.Join(dir, "versions.tf"))
+	if err != nil {
+		t.Fatalf("expected versions.tf to be created: %s", err)
+	}
+	if !strings.Contains(string(versionsGot), "baz") {
+		t.Fatalf("expected versions.tf to contain baz, got:\n%s", versionsGot)
+	}
+}
+
+// TestZeroThirteenUpgradeCommand_upgradeJSON_schema checks that -json output
+// reflects the detected_from value for each provider, flags providers with
+// no detected source in undetected_providers, and omits "original" for
+// files that were newly created rather than rewritten.
+func TestZeroThirteenUpgradeCommand_upgradeJSON_schema(t *testing.T) {
+	requiredProviders := map[string]*configs.RequiredProvider{
+		"foo": {Name: "foo", Type: addrs.NewLegacyProvider("foo")},
+		"bar": {Name: "bar", Type: addrs.Provider{}},
+	}
+	detectedFrom := map[string]string{
+		"foo": "explicit",
+		"bar": "resource",
+	}
+	rewrites := []fileRewrite{
+		{Filename: "main.tf", Original: "terraform {}\n", Rewritten: "terraform {\n  # rewritten\n}\n"},
+		{Filename: "versions.tf", Rewritten: "terraform {\n  # new\n}\n"},
+	}
+
+	var c ZeroThirteenUpgradeCommand
+	data, err := c.upgradeJSON(requiredProviders, detectedFrom, rewrites)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var got jsonUpgrade
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to unmarshal -json output: %s\n%s", err, data)
+	}
+
+	if got.Providers["foo"].DetectedFrom != "explicit" {
+		t.Fatalf("expected foo to be detected_from explicit, got %q", got.Providers["foo"].DetectedFrom)
+	}
+	if got.Providers["bar"].DetectedFrom != "resource" {
+		t.Fatalf("expected bar to be detected_from resource, got %q", got.Providers["bar"].DetectedFrom)
+	}
+	if len(got.UndetectedProviders) != 1 || got.UndetectedProviders[0] != "bar" {
+		t.Fatalf("expected bar to be listed as an undetected provider, got %v", got.UndetectedProviders)
+	}
+
+	if len(got.Files) != 2 {
+		t.Fatalf("expected 2 files in output, got %d", len(got.Files))
+	}
+	if got.Files[0].Original == "" {
+		t.Fatalf("expected main.tf to retain its original content in the output")
+	}
+	if got.Files[1].Original != "" {
+		t.Fatalf("expected versions.tf, a newly-created file, to have no original content, got %q", got.Files[1].Original)
+	}
+}
+
+// TestZeroThirteenUpgradeCommand_dryRun checks that passing dryRun to
+// rewriteRequiredProviders reports the rewritten content without actually
+// writing it to disk.
+func TestZeroThirteenUpgradeCommand_dryRun(t *testing.T) {
+	fixture, err := ioutil.ReadFile("testdata/013upgrade-no-source/input.tf")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "013upgrade-dry-run")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "main.tf")
+	if err := ioutil.WriteFile(filename, fixture, 0644); err != nil {
+		t.Fatalf("failed to write fixture to temp dir: %s", err)
+	}
+
+	requiredProviders := map[string]*configs.RequiredProvider{
+		"mystery": {Name: "mystery", Type: addrs.Provider{}},
+	}
+
+	var c ZeroThirteenUpgradeCommand
+	rewrite, diags := c.rewriteRequiredProviders(filename, []string{"mystery"}, requiredProviders, true)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %s", diags.Err())
+	}
+	if rewrite.Rewritten == rewrite.Original {
+		t.Fatalf("expected dry-run to still report the rewritten content distinct from the original")
+	}
+
+	onDisk, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read file after dry run: %s", err)
+	}
+	if string(onDisk) != string(fixture) {
+		t.Fatalf("expected -dry-run to leave the file on disk unchanged, got:\n%s", onDisk)
+	}
+}